@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Wrap h so it is only reachable with ADMIN_TOKEN, passed as the "token"
+// query parameter or a bearer Authorization header. Without a configured
+// token the admin API does not exist. Every call is recorded in the audit log.
+func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdmin(w, r) {
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		h(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		audit.add(r, rec.status)
+	}
+}
+
+// Like requireAdmin for read-only endpoints that monitors poll, such as
+// /metrics, where recording every scrape would flush the audit log. Rejected
+// calls are still recorded.
+func requireMonitor(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if checkAdmin(w, r) {
+			h(w, r)
+		}
+	}
+}
+
+// Check the request's token, answering it and reporting false if it is
+// missing or wrong.
+func checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if adminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		http.Error(w, tr("unauthorized"), http.StatusUnauthorized)
+		audit.add(r, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
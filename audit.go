@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Client string    `json:"client"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Params string    `json:"params,omitempty"`
+	Status int       `json:"status"`
+}
+
+// The most recent admin API calls, including rejected ones. Rejected calls
+// are kept apart with a smaller cap, so a client guessing tokens cannot push
+// the authorized calls out.
+type auditLog struct {
+	mu          sync.Mutex
+	max         int
+	maxRejected int
+	entries     []auditEntry
+	rejected    []auditEntry
+}
+
+var audit = &auditLog{max: 1000, maxRejected: 100}
+
+func (a *auditLog) add(r *http.Request, status int) {
+	params := r.URL.Query()
+	params.Del("token")
+	e := auditEntry{
+		Time:   time.Now().UTC(),
+		Client: clientIP(r),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Params: params.Encode(),
+		Status: status,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if status == http.StatusUnauthorized {
+		a.rejected = appendAudit(a.rejected, e, a.maxRejected)
+	} else {
+		a.entries = appendAudit(a.entries, e, a.max)
+	}
+}
+
+// Append e, dropping the oldest entries beyond max.
+func appendAudit(entries []auditEntry, e auditEntry, max int) []auditEntry {
+	entries = append(entries, e)
+	if over := len(entries) - max; over > 0 {
+		entries = append([]auditEntry(nil), entries[over:]...)
+	}
+	return entries
+}
+
+// Serves both kinds of calls merged back into time order.
+func (a *auditLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	all := make([]auditEntry, 0, len(a.entries)+len(a.rejected))
+	i, j := 0, 0
+	for i < len(a.entries) || j < len(a.rejected) {
+		if j == len(a.rejected) || i < len(a.entries) && !a.entries[i].Time.After(a.rejected[j].Time) {
+			all = append(all, a.entries[i])
+			i++
+		} else {
+			all = append(all, a.rejected[j])
+			j++
+		}
+	}
+	a.mu.Unlock()
+	data, err := json.Marshal(all)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Captures the status code written by an admin handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Lets http.ResponseController reach Flush and deadlines underneath.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Destination rules checked before dialing a target, with a hit counter per
+// rule so operators can see what is being attempted.
+type blocklist struct {
+	ports   map[uint16]bool
+	domains []string
+
+	mu   sync.Mutex
+	hits map[string]int64
+}
+
+// Parse comma separated port and domain lists. A domain also blocks all of
+// its subdomains.
+func parseBlocklist(ports, domains string) (*blocklist, error) {
+	b := &blocklist{
+		ports: make(map[uint16]bool),
+		hits:  make(map[string]int64),
+	}
+	for _, p := range strings.Split(ports, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", p)
+		}
+		b.ports[uint16(n)] = true
+	}
+	for _, d := range strings.Split(domains, ",") {
+		d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "."))
+		if d != "" {
+			b.domains = append(b.domains, d)
+		}
+	}
+	return b, nil
+}
+
+// Report the rule blocking host:port and count the hit, or "" if allowed.
+func (b *blocklist) check(host string, port uint16) string {
+	if b == nil {
+		return ""
+	}
+
+	var rule string
+	if b.ports[port] {
+		rule = fmt.Sprintf("port:%d", port)
+	} else {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		for _, d := range b.domains {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				rule = "domain:" + d
+				break
+			}
+		}
+	}
+	if rule == "" {
+		return ""
+	}
+
+	b.mu.Lock()
+	b.hits[rule]++
+	b.mu.Unlock()
+	return rule
+}
+
+func (b *blocklist) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	data, err := json.Marshal(b.hits)
+	b.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Inbound filter on the client country reported by Cloudflare in
+// CF-IPCountry, believed under the same rules as CF-Connecting-IP. Clients
+// without the header, or from an unknown country, are only let through when
+// there is no allow list.
+type countryFilter struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+func parseCountries(list string) map[string]bool {
+	var m map[string]bool
+	for _, c := range strings.Split(list, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]bool)
+		}
+		m[c] = true
+	}
+	return m
+}
+
+func (f *countryFilter) allowed(r *http.Request) bool {
+	var country string
+	if trustHeaders(r) {
+		country = strings.ToUpper(r.Header.Get("CF-IPCountry"))
+	}
+	if country == "" || country == "XX" {
+		return f.allow == nil
+	}
+	if f.deny[country] {
+		return false
+	}
+	return f.allow == nil || f.allow[country]
+}
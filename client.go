@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client for control-plane requests such as hook callbacks, sent through
+// CONTROL_PROXY (http, https or socks5) with USER_AGENT when set. Relayed
+// traffic never goes through it.
+var controlClient = http.DefaultClient
+
+type userAgentTransport struct {
+	base http.RoundTripper
+	ua   string
+}
+
+func (t *userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("User-Agent", t.ua)
+	return t.base.RoundTrip(r)
+}
+
+func newControlClient(proxy, ua string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", proxy)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	var rt http.RoundTripper = transport
+	if ua != "" {
+		rt = &userAgentTransport{base: transport, ua: ua}
+	}
+	return &http.Client{Transport: rt, Timeout: time.Minute}, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type connLogEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Client string    `json:"client"`
+	Dest   string    `json:"dest"`
+	Port   uint16    `json:"port"`
+}
+
+// Opt-in record of who connected where. IP addresses are replaced with a
+// keyed hash so entries can be correlated without storing the address, and
+// entries older than retention or beyond max are dropped.
+type connLog struct {
+	mu        sync.Mutex
+	key       []byte
+	retention time.Duration
+	max       int
+	entries   []connLogEntry
+}
+
+func newConnLog(salt string, retention time.Duration, max int) *connLog {
+	key := []byte(salt)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &connLog{
+		key:       key,
+		retention: retention,
+		max:       max,
+	}
+}
+
+func (l *connLog) hashIP(ip string) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+func (l *connLog) add(user, client, dest string, port uint16) {
+	if l == nil {
+		return
+	}
+
+	if net.ParseIP(dest) != nil {
+		dest = l.hashIP(dest)
+	}
+	e := connLogEntry{
+		Time:   time.Now().UTC(),
+		User:   user,
+		Client: l.hashIP(client),
+		Dest:   dest,
+		Port:   port,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	l.prune()
+}
+
+// Drop expired entries and keep at most max. Caller holds mu.
+func (l *connLog) prune() {
+	cutoff := time.Now().Add(-l.retention)
+	i := 0
+	for i < len(l.entries) && l.entries[i].Time.Before(cutoff) {
+		i++
+	}
+	if over := len(l.entries) - i - l.max; over > 0 {
+		i += over
+	}
+	if i > 0 {
+		l.entries = append([]connLogEntry(nil), l.entries[i:]...)
+	}
+}
+
+func (l *connLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if l == nil {
+		http.Error(w, tr("connection log disabled"), http.StatusNotFound)
+		return
+	}
+
+	l.mu.Lock()
+	l.prune()
+	data, err := json.Marshal(l.entries)
+	l.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
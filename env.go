@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names used for the same settings by the NodeJS and shell variants of this
+// script, still accepted so existing platform configs keep working.
+var envAliases = map[string][]string{
+	"PORT": {"SERVER_PORT"},
+}
+
+// Settings from CONFIG_FILE, a YAML or JSON map keyed by the same names as
+// the environment variables. The environment takes precedence.
+var (
+	configMu   sync.RWMutex
+	fileConfig = mustReadConfig(os.Getenv("CONFIG_FILE"))
+)
+
+// Every name getenv has been asked for, to spot config file keys that no
+// setting reads.
+var knownSettings sync.Map
+
+// Look up a setting by its name here, falling back to deprecated aliases and
+// then the config file.
+func getenv(name string) string {
+	knownSettings.Store(name, true)
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	for _, alias := range envAliases[name] {
+		if v := os.Getenv(alias); v != "" {
+			logf("%s is deprecated, use %s", alias, name)
+			return v
+		}
+	}
+
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return fileConfig[name]
+}
+
+// Parse a config file into setting values. Scalars are used as written and
+// lists are joined with commas, matching the comma separated env values.
+func readConfig(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg := make(map[string]string, len(raw))
+	var bad []string
+	for name, v := range raw {
+		switch v := v.(type) {
+		case nil:
+		case map[string]any:
+			bad = append(bad, name)
+		case []any:
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				switch item.(type) {
+				case map[string]any, []any:
+					bad = append(bad, name)
+				}
+				parts = append(parts, fmt.Sprint(item))
+			}
+			cfg[name] = strings.Join(parts, ",")
+		default:
+			cfg[name] = fmt.Sprint(v)
+		}
+	}
+	if len(bad) > 0 {
+		sort.Strings(bad)
+		return nil, fmt.Errorf("%s: expected a value or a list of values for %s", path, strings.Join(bad, ", "))
+	}
+	return cfg, nil
+}
+
+// Config file keys that are not a setting, most likely typos.
+func unknownSettings() []string {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	var names []string
+	for name := range fileConfig {
+		if _, ok := knownSettings.Load(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mustReadConfig(path string) map[string]string {
+	cfg, err := readConfig(path)
+	if err != nil {
+		fatalf("Invalid CONFIG_FILE: %v", err)
+	}
+	return cfg
+}
+
+// Re-read CONFIG_FILE, keeping the current values if it is invalid.
+func reloadConfig() error {
+	cfg, err := readConfig(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return err
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	fileConfig = cfg
+	return nil
+}
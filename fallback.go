@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Parse comma separated path=port (or path=host:port) pairs into reverse
+// proxies, so other local services can share the relay's hostname. Request
+// paths are forwarded unchanged.
+func parseFallbacks(spec string) (map[string]http.Handler, error) {
+	fallbacks := make(map[string]http.Handler)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		path, target, ok := strings.Cut(pair, "=")
+		if !ok || !strings.HasPrefix(path, "/") || path == "/" {
+			return nil, fmt.Errorf("invalid fallback %q", pair)
+		}
+		if !strings.Contains(target, ":") {
+			target = net.JoinHostPort("127.0.0.1", target)
+		}
+		u, err := url.Parse("http://" + target)
+		if err != nil || u.Port() == "" {
+			return nil, fmt.Errorf("invalid fallback %q", pair)
+		}
+		fallbacks[strings.TrimSuffix(path, "/")] = httputil.NewSingleHostReverseProxy(u)
+	}
+	return fallbacks, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Serve files from dir under /files/ so client profiles can reference rule
+// sets hosted on the same domain. Directory listings are not exposed.
+func fileServer(dir string) http.Handler {
+	fs := http.StripPrefix("/files/", http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		fs.ServeHTTP(w, r)
+	})
+}
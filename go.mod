@@ -1,7 +1,10 @@
-module hello-world
-
-go 1.21
-
-require github.com/gorilla/websocket v1.5.1
-
-require golang.org/x/net v0.17.0 // indirect
+module hello-world
+
+go 1.21
+
+require (
+	github.com/gorilla/websocket v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/net v0.17.0 // indirect
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const hookTimeout = 30 * time.Second
+
+// Run HOOK_CMD and post to HOOK_URL for a lifecycle event. The command gets
+// the event and its details as HOOK_* environment variables, the callback
+// gets them as a JSON body. Hooks run in the background and failures are
+// only logged.
+func runHooks(event string, details map[string]string) {
+	if hookCmd == "" && hookURL == "" {
+		return
+	}
+
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if hooksClosed {
+		return
+	}
+	hooksWG.Add(1)
+	go func() {
+		defer hooksWG.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+		defer cancel()
+
+		if hookCmd != "" {
+			// The deploy image has no shell, so the command is split on
+			// whitespace and executed directly.
+			args := strings.Fields(hookCmd)
+			if len(args) == 0 {
+				return
+			}
+			cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+			cmd.Env = append(os.Environ(), "HOOK_EVENT="+event)
+			for k, v := range details {
+				cmd.Env = append(cmd.Env, "HOOK_"+strings.ToUpper(k)+"="+v)
+			}
+			out := io.MultiWriter(os.Stdout, logRings["hooks"])
+			cmd.Stdout = out
+			cmd.Stderr = out
+			if err := cmd.Run(); err != nil {
+				hookFailures.Add(1)
+				logf("Hook %s error: %v", event, err)
+			}
+		}
+
+		if hookURL != "" {
+			body, _ := json.Marshal(map[string]any{
+				"event":   event,
+				"time":    time.Now().UTC(),
+				"details": details,
+			})
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader(body))
+			if err != nil {
+				hookFailures.Add(1)
+				logf("Hook %s error: %v", event, err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := controlClient.Do(req)
+			if err != nil {
+				hookFailures.Add(1)
+				logf("Hook %s error: %v", event, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				hookFailures.Add(1)
+				logf("Hook %s error: %v", event, resp.Status)
+			}
+		}
+	}()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Message language, taken from LANG ("zh_CN.UTF-8", "zh", ...). Anything
+// without a catalog falls back to English.
+var lang = parseLang(os.Getenv("LANG"))
+
+// CONFIG_FILE is read while the package vars are set up, which themselves log
+// through tr, so a LANG from the file only applies once they are done.
+func init() {
+	lang = parseLang(getenv("LANG"))
+}
+
+func parseLang(l string) string {
+	if strings.HasPrefix(strings.ToLower(l), "zh") {
+		return "zh"
+	}
+	return "en"
+}
+
+// Translations keyed by the English message, which doubles as the fallback.
+var catalog = map[string]map[string]string{
+	"zh": {
+		"Invalid CONFIG_FILE: %v":                          "CONFIG_FILE 无效: %v",
+		"Invalid %v":                                       "无效的 %v",
+		"Reload error: %v":                                 "重新加载失败: %v",
+		"reloaded: %d users":                               "已重新加载: %d 个用户",
+		"users: %d":                                        "用户数: %d",
+		"Invalid RATE_LIMIT: %v":                           "RATE_LIMIT 无效: %v",
+		"rate limit: %g Mbps":                              "限速: %g Mbps",
+		"Invalid MAX_CONNS: %v":                            "MAX_CONNS 无效: %v",
+		"conn limit: %d per client":                        "连接数限制: 每个客户端 %d",
+		"Invalid DEVICE_LIMIT: %v":                         "DEVICE_LIMIT 无效: %v",
+		"Invalid DEVICE_WINDOW: %v":                        "DEVICE_WINDOW 无效: %v",
+		"device limit: %d per %v":                          "设备数限制: 每 %[2]v %[1]d 个",
+		"Invalid CONN_LOG_RETENTION: %v":                   "CONN_LOG_RETENTION 无效: %v",
+		"Invalid CONN_LOG_MAX: %v":                         "CONN_LOG_MAX 无效: %v",
+		"connection log: %v, %d entries":                   "连接日志: 保留 %v, 最多 %d 条",
+		"Invalid TRUSTED_PROXIES: %v":                      "TRUSTED_PROXIES 无效: %v",
+		"Invalid SCHEDULE_TIMEZONE: %v":                    "SCHEDULE_TIMEZONE 无效: %v",
+		"Invalid WS_IDLE_TIMEOUT: %v":                      "WS_IDLE_TIMEOUT 无效: %v",
+		"Invalid WS_KEEPALIVE: %v":                         "WS_KEEPALIVE 无效: %v",
+		"Invalid CONTROL_PROXY: %v":                        "CONTROL_PROXY 无效: %v",
+		"Invalid FALLBACKS: %v":                            "FALLBACKS 无效: %v",
+		"fallback: %s":                                     "回落: %s",
+		"Invalid SHUTDOWN_GRACE: %v":                       "SHUTDOWN_GRACE 无效: %v",
+		"shutdown: %v":                                     "正在关闭: %v",
+		"Shutdown error: %v":                               "关闭出错: %v",
+		"Invalid KEEPALIVE_INTERVAL: %v":                   "KEEPALIVE_INTERVAL 无效: %v",
+		"keep-alive: %d urls every %v":                     "保活: 每 %[2]v 访问 %[1]d 个地址",
+		"Keep-alive %s error: %v":                          "保活 %s 失败: %v",
+		"ws path: %s":                                      "WebSocket 路径: %s",
+		"listen: %s":                                       "监听: %s",
+		"Failed to listen: %v":                             "监听失败: %v",
+		"Serve error: %v":                                  "服务错误: %v",
+		"Country rejected: %s":                             "拒绝的国家: %s",
+		"Upgrade error: %v":                                "WebSocket 升级失败: %v",
+		"Read message error: %v":                           "读取消息失败: %v",
+		"Conn limit reached: %s":                           "连接数已达上限: %s",
+		"Device limit exceeded: %s has %d addresses in %v": "设备数超限: %s 在 %[3]v 内有 %[2]d 个地址",
+		"Blocked: %s %d (%s)":                              "已拦截: %s %d (%s)",
+		"conn: %s %d":                                      "连接: %s %d",
+		"Write message error: %v":                          "发送消息失败: %v",
+		"Conn-Err: %v %s:%d":                               "连接失败: %v %s:%d",
+		"Write to target error: %v":                        "写入目标失败: %v",
+		"speedtest: %d bytes in %v":                        "测速: %d 字节, 用时 %v",
+		"Hook %s error: %v":                                "钩子 %s 执行失败: %v",
+		"Read traffic error: %v":                           "读取流量统计失败: %v",
+		"Parse traffic error: %v":                          "解析流量统计失败: %v",
+		"traffic reset: %s -> %s":                          "流量重置: %s -> %s",
+		"%s is deprecated, use %s":                         "%s 已弃用, 请使用 %s",
+		"Traffic file missing, rewriting: %s":              "流量统计文件丢失, 正在重写: %s",
+		"Encode traffic error: %v":                         "编码流量统计失败: %v",
+		"Write traffic error: %v":                          "保存流量统计失败: %v",
+
+		"config %s: %s: %s":                    "配置%s: %s: %s",
+		"Invalid configuration: %d errors":     "配置无效: %d 个错误",
+		"warning":                              "警告",
+		"unknown setting %s":                   "未知设置 %s",
+		"error":                                "错误",
+		"%q is not a port between 1 and 65535": "%q 不是 1 到 65535 之间的端口",
+		"not set, the built-in default UUID is public":                                "未设置, 内置默认 UUID 是公开的",
+		"ignored because UUIDS is set":                                                "已设置 UUIDS, 忽略此项",
+		"not set, DEVICE_WINDOW and DEVICE_LIMIT_MODE are ignored":                    "未设置, 忽略 DEVICE_WINDOW 和 DEVICE_LIMIT_MODE",
+		"CF-IPCountry is believed from any client, set TRUSTED_PROXIES to the CDN":    "任何客户端都可伪造 CF-IPCountry, 请将 TRUSTED_PROXIES 设为 CDN",
+		"%q is not alert or block, blocking":                                          "%q 不是 alert 或 block, 按 block 处理",
+		"enabled without ADMIN_TOKEN, the log cannot be exported":                     "已启用但未设置 ADMIN_TOKEN, 日志无法导出",
+		"not enabled, CONN_LOG_RETENTION, CONN_LOG_MAX and CONN_LOG_SALT are ignored": "未启用, 忽略 CONN_LOG_RETENTION, CONN_LOG_MAX 和 CONN_LOG_SALT",
+		"%q is not true or false, disabled":                                           "%q 不是 true 或 false, 已禁用",
+		"not set, /admin, /api, /status and /metrics are disabled":                    "未设置, /admin, /api, /status 和 /metrics 已禁用",
+		"shorter than 16 characters":                                                  "少于 16 个字符",
+		"not set, KEEPALIVE_INTERVAL is ignored":                                      "未设置, 忽略 KEEPALIVE_INTERVAL",
+		"%q is not an http(s) URL":                                                    "%q 不是 http(s) 地址",
+		"%q is blank":                                                                 "%q 为空",
+		"%s conflicts with the built-in %s route":                                     "%s 与内置路由 %s 冲突",
+		"%s conflicts with the FALLBACKS route %s":                                    "%s 与 FALLBACKS 路由 %s 冲突",
+		"%q must start with / or be auto":                                             "%q 必须以 / 开头或为 auto",
+		"%q is not a directory":                                                       "%q 不是目录",
+
+		"unauthorized":            "未授权",
+		"forbidden":               "禁止访问",
+		"connection log disabled": "连接日志未启用",
+		"invalid size":            "大小无效",
+		"method not allowed":      "不支持的请求方法",
+	},
+}
+
+// Translate msg into the configured language.
+func tr(msg string) string {
+	if t, ok := catalog[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+func sprintf(format string, args ...any) string {
+	return fmt.Sprintf(tr(format), args...)
+}
+
+func logf(format string, args ...any) {
+	log.Printf(tr(format), args...)
+}
+
+func fatalf(format string, args ...any) {
+	log.Fatalf(tr(format), args...)
+}
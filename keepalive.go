@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// GET each url every interval, plus up to a fifth of it in random jitter, so
+// platforms that put idle apps to sleep keep this one awake. Failures are
+// only logged.
+func runKeepAlive(urls []string, interval time.Duration) {
+	for {
+		jitter := time.Duration(rand.Int63n(int64(interval)/5 + 1))
+		time.Sleep(interval + jitter)
+
+		for _, u := range urls {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+			if err != nil {
+				cancel()
+				keepAliveFailures.Add(1)
+				logf("Keep-alive %s error: %v", u, err)
+				continue
+			}
+			resp, err := controlClient.Do(req)
+			if err != nil {
+				cancel()
+				keepAliveFailures.Add(1)
+				logf("Keep-alive %s error: %v", u, err)
+				continue
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			cancel()
+			if resp.StatusCode >= 400 {
+				keepAliveFailures.Add(1)
+				logf("Keep-alive %s error: %v", u, resp.Status)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Token bucket shared by all relays, so the configured rate caps the total
+// throughput of the process rather than each connection.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec float64) *rateLimiter {
+	burst := bytesPerSec
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+	return &rateLimiter{
+		rate:   bytesPerSec,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Block until n bytes may be sent. A nil limiter never blocks.
+func (l *rateLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// Counts open relays per client id and refuses new ones beyond max.
+type connLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[string]int
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{
+		max:    max,
+		active: make(map[string]int),
+	}
+}
+
+// Reserve a slot for id, reporting false if it already has max relays open.
+// A nil limiter always succeeds.
+func (l *connLimiter) acquire(id string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[id] >= l.max {
+		return false
+	}
+	l.active[id]++
+	return true
+}
+
+func (l *connLimiter) release(id string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active[id]--
+	if l.active[id] <= 0 {
+		delete(l.active, id)
+	}
+}
+
+// Tracks the distinct source IPs seen per client id over a rolling window, to
+// spot a credential shared beyond max devices.
+type deviceLimiter struct {
+	mu      sync.Mutex
+	max     int
+	window  time.Duration
+	enforce bool
+	seen    map[string]map[string]time.Time
+	// When each id/ip pair over the limit was last reported to the hooks
+	alerted map[string]time.Time
+}
+
+func newDeviceLimiter(max int, window time.Duration, enforce bool) *deviceLimiter {
+	return &deviceLimiter{
+		max:     max,
+		window:  window,
+		enforce: enforce,
+		seen:    make(map[string]map[string]time.Time),
+		alerted: make(map[string]time.Time),
+	}
+}
+
+// Record a connection from ip, reporting false if it should be refused. Going
+// over the limit is always logged; it only refuses when enforcing. A nil
+// limiter always succeeds.
+func (l *deviceLimiter) check(id, ip string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	ips := l.seen[id]
+	if ips == nil {
+		ips = make(map[string]time.Time)
+		l.seen[id] = ips
+	}
+	for k, t := range ips {
+		if now.Sub(t) > l.window {
+			delete(ips, k)
+		}
+	}
+	if _, ok := ips[ip]; !ok && len(ips) >= l.max {
+		logf("Device limit exceeded: %s has %d addresses in %v", id, len(ips)+1, l.window)
+		// A refused client keeps reconnecting, so notify once per window.
+		for k, t := range l.alerted {
+			if now.Sub(t) > l.window {
+				delete(l.alerted, k)
+			}
+		}
+		if key := id + " " + ip; l.alerted[key].IsZero() {
+			l.alerted[key] = now
+			runHooks("device-limit", map[string]string{
+				"user":      id,
+				"ip":        ip,
+				"addresses": strconv.Itoa(len(ips) + 1),
+				"window":    l.window.String(),
+			})
+		}
+		if l.enforce {
+			return false
+		}
+	}
+	ips[ip] = now
+	return true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The last lines written by one component, with followers that get each new
+// line as it arrives.
+type logRing struct {
+	mu        sync.Mutex
+	max       int
+	lines     []string
+	partial   []byte
+	followers map[chan string]struct{}
+}
+
+func newLogRing(max int) *logRing {
+	return &logRing{
+		max:       max,
+		followers: make(map[chan string]struct{}),
+	}
+}
+
+// Captured output per component for /admin/logs: the relay's own log and the
+// output of hook commands.
+var logRings = map[string]*logRing{
+	"relay": newLogRing(1000),
+	"hooks": newLogRing(1000),
+}
+
+func (l *logRing) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(l.partial[:i])
+		l.partial = l.partial[i+1:]
+
+		l.lines = append(l.lines, line)
+		if over := len(l.lines) - l.max; over > 0 {
+			l.lines = append([]string(nil), l.lines[over:]...)
+		}
+		for ch := range l.followers {
+			// A follower that cannot keep up misses lines rather than
+			// stalling the writer.
+			select {
+			case ch <- line:
+			default:
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// Copy of the buffered lines, plus a channel of new ones when follow is set.
+func (l *logRing) snapshot(follow bool) ([]string, chan string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines := append([]string(nil), l.lines...)
+	if !follow {
+		return lines, nil
+	}
+	ch := make(chan string, 256)
+	l.followers[ch] = struct{}{}
+	return lines, ch
+}
+
+func (l *logRing) unfollow(ch chan string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.followers, ch)
+}
+
+// Serve /admin/logs/{component} as plain text. With follow=true the response
+// stays open and streams new lines until the client leaves or the relay
+// shuts down.
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+	ring := logRings[strings.TrimPrefix(r.URL.Path, "/admin/logs/")]
+	if ring == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	lines, ch := ring.snapshot(r.URL.Query().Get("follow") == "true")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		w.Write([]byte(line + "\n"))
+	}
+	if ch == nil {
+		return
+	}
+	defer ring.unfollow(ch)
+
+	rc := http.NewResponseController(w)
+	rc.Flush()
+	for {
+		select {
+		case line := <-ch:
+			if _, err := w.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+			rc.Flush()
+		case <-r.Context().Done():
+			return
+		case <-stopping:
+			return
+		}
+	}
+}
@@ -3,70 +3,365 @@ package main
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/gorilla/websocket"
 )
 
 var (
-	uuid = strings.ReplaceAll(os.Getenv("UUID"), "-", "")
-	port = os.Getenv("PORT")
+	uuid = getenv("UUID")
+	// Comma separated [alias:]uuid list for several clients, replaces UUID
+	uuidList = getenv("UUIDS")
+	port     = getenv("PORT")
+	// Interface to bind, e.g. 127.0.0.1 or ::, empty for all, or
+	// unix:/path/to.sock to listen on a unix socket instead of PORT
+	listenAddr = getenv("LISTEN_ADDR")
+
+	// Total relay throughput cap in Mbps, empty or 0 for unlimited
+	rateLimit = getenv("RATE_LIMIT")
+	// Concurrent relays allowed per UUID, empty or 0 for unlimited
+	maxConns = getenv("MAX_CONNS")
+	// Where monthly traffic counters are persisted, "-" to keep them in memory
+	trafficFile = getenv("TRAFFIC_FILE")
+	// IANA zone for scheduled work such as the monthly traffic reset,
+	// defaulting to the process timezone (TZ)
+	scheduleTimezone = getenv("SCHEDULE_TIMEZONE")
+	// Comma separated destination ports and domains the relay refuses to dial
+	blockPorts   = getenv("BLOCK_PORTS")
+	blockDomains = getenv("BLOCK_DOMAINS")
+	// Distinct client addresses allowed per UUID within DEVICE_WINDOW. With
+	// DEVICE_LIMIT_MODE=alert going over is only logged.
+	deviceLimit     = getenv("DEVICE_LIMIT")
+	deviceWindow    = getenv("DEVICE_WINDOW")
+	deviceLimitMode = getenv("DEVICE_LIMIT_MODE")
+	// Comma separated ISO country codes to accept or reject clients from, as
+	// reported in CF-IPCountry. Without TRUSTED_PROXIES anyone reaching the app
+	// directly can set that header.
+	allowCountries = getenv("ALLOW_COUNTRIES")
+	blockCountries = getenv("BLOCK_COUNTRIES")
+	// Opt-in connection log, kept in memory for CONN_LOG_RETENTION (a Go
+	// duration) up to CONN_LOG_MAX entries. CONN_LOG_SALT keys the IP hashes.
+	connLogEnable    = getenv("CONN_LOG")
+	connLogRetention = getenv("CONN_LOG_RETENTION")
+	connLogMax       = getenv("CONN_LOG_MAX")
+	connLogSalt      = getenv("CONN_LOG_SALT")
+	// Close relays with no traffic in either direction for WS_IDLE_TIMEOUT, and
+	// set the TCP keepalive period of both legs to WS_KEEPALIVE (Go durations)
+	wsIdleTimeout = getenv("WS_IDLE_TIMEOUT")
+	wsKeepAlive   = getenv("WS_KEEPALIVE")
+	// Only upgrade WebSocket requests on this path, "auto" to derive one from
+	// the (first) UUID. Any path is accepted when unset.
+	wsPath = getenv("WS_PATH")
+	// Directory served read-only under /files/, e.g. clash or sing-box rule sets
+	filesDir = getenv("FILES_DIR")
+	// Command and/or URL notified of lifecycle events (post-listen,
+	// traffic-reset, device-limit, pre-shutdown)
+	hookCmd = getenv("HOOK_CMD")
+	hookURL = getenv("HOOK_URL")
+	// Extra path=port routes proxied to local services, e.g. /panel=9000
+	fallbackSpec = getenv("FALLBACKS")
+	// User-Agent and egress proxy for control-plane requests like hook callbacks
+	userAgent    = getenv("USER_AGENT")
+	controlProxy = getenv("CONTROL_PROXY")
+	// Comma separated URLs (e.g. the public project URL) fetched every
+	// KEEPALIVE_INTERVAL, default 5m, to stop the platform idling the app
+	keepAliveURLs     = getenv("KEEPALIVE_URLS")
+	keepAliveInterval = getenv("KEEPALIVE_INTERVAL")
+	// How long open relays get to finish after SIGTERM, default 10s
+	shutdownGrace = getenv("SHUTDOWN_GRACE")
+	// Enables the /admin endpoints when set
+	adminToken = getenv("ADMIN_TOKEN")
+	// Comma separated addresses or CIDRs of the proxies in front of the relay.
+	// When set, CF-Connecting-IP and X-Forwarded-For are only believed from
+	// them; otherwise CF-Connecting-IP is believed from anyone and
+	// X-Forwarded-For is ignored.
+	trustedProxySpec = getenv("TRUSTED_PROXIES")
+
+	users   []user
+	limiter *rateLimiter
+	conns   *connLimiter
+	devices *deviceLimiter
+	traffic *trafficStats
+	blocked *blocklist
+	connlog *connLog
+	geo     *countryFilter
+
+	idleTimeout time.Duration
+	keepAlive   time.Duration
 )
 
 func main() {
-	if uuid == "" {
-		uuid = "b84a3458-e83a-4337-ada2-b303b6d2a841"
-	}
+	log.SetOutput(io.MultiWriter(os.Stderr, logRings["relay"]))
 	if port == "" {
 		port = "3000"
 	}
+	reportConfig(validateConfig())
 
-	log.Printf("listen: %s", port)
-	server, err := net.Listen("tcp", ":"+port)
+	err := loadAccess(accessSettings{
+		uuid:           uuid,
+		uuidList:       uuidList,
+		blockPorts:     blockPorts,
+		blockDomains:   blockDomains,
+		allowCountries: allowCountries,
+		blockCountries: blockCountries,
+	})
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		fatalf("Invalid %v", err)
+	}
+	if len(users) > 1 {
+		logf("users: %d", len(users))
+	}
+	if trafficFile == "" {
+		trafficFile = "traffic.json"
+	}
+	if rateLimit != "" {
+		mbps, err := strconv.ParseFloat(rateLimit, 64)
+		if err != nil {
+			fatalf("Invalid RATE_LIMIT: %v", err)
+		}
+		if mbps > 0 {
+			limiter = newRateLimiter(mbps * 1000 * 1000 / 8)
+			logf("rate limit: %g Mbps", mbps)
+		}
+	}
+	if maxConns != "" {
+		n, err := strconv.Atoi(maxConns)
+		if err != nil {
+			fatalf("Invalid MAX_CONNS: %v", err)
+		}
+		if n > 0 {
+			conns = newConnLimiter(n)
+			logf("conn limit: %d per client", n)
+		}
 	}
 
-	upgrader := websocket.Upgrader{}
-
-	for {
-		conn, err := server.Accept()
+	if deviceLimit != "" {
+		n, err := strconv.Atoi(deviceLimit)
+		if err != nil {
+			fatalf("Invalid DEVICE_LIMIT: %v", err)
+		}
+		window := time.Hour
+		if deviceWindow != "" {
+			window, err = time.ParseDuration(deviceWindow)
+			if err != nil || window <= 0 {
+				fatalf("Invalid DEVICE_WINDOW: %v", deviceWindow)
+			}
+		}
+		if n > 0 {
+			devices = newDeviceLimiter(n, window, deviceLimitMode != "alert")
+			logf("device limit: %d per %v", n, window)
+		}
+	}
+	if connLogEnable == "true" {
+		retention := 24 * time.Hour
+		if connLogRetention != "" {
+			retention, err = time.ParseDuration(connLogRetention)
+			if err != nil || retention <= 0 {
+				fatalf("Invalid CONN_LOG_RETENTION: %v", connLogRetention)
+			}
+		}
+		max := 10000
+		if connLogMax != "" {
+			max, err = strconv.Atoi(connLogMax)
+			if err != nil || max <= 0 {
+				fatalf("Invalid CONN_LOG_MAX: %v", connLogMax)
+			}
+		}
+		connlog = newConnLog(connLogSalt, retention, max)
+		logf("connection log: %v, %d entries", retention, max)
+	}
+	trustedProxies, err = parseProxies(trustedProxySpec)
+	if err != nil {
+		fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	if scheduleTimezone != "" {
+		loc, err := time.LoadLocation(scheduleTimezone)
+		if err != nil {
+			fatalf("Invalid SCHEDULE_TIMEZONE: %v", err)
+		}
+		scheduleLoc = loc
+	}
+	if wsIdleTimeout != "" {
+		idleTimeout, err = time.ParseDuration(wsIdleTimeout)
 		if err != nil {
-			log.Printf("Accept error: %v", err)
-			continue
+			fatalf("Invalid WS_IDLE_TIMEOUT: %v", err)
 		}
-		go handleConnection(conn, upgrader)
 	}
+	if wsKeepAlive != "" {
+		keepAlive, err = time.ParseDuration(wsKeepAlive)
+		if err != nil {
+			fatalf("Invalid WS_KEEPALIVE: %v", err)
+		}
+	}
+	grace := 10 * time.Second
+	if shutdownGrace != "" {
+		grace, err = time.ParseDuration(shutdownGrace)
+		if err != nil {
+			fatalf("Invalid SHUTDOWN_GRACE: %v", err)
+		}
+	}
+	if userAgent != "" || controlProxy != "" {
+		controlClient, err = newControlClient(controlProxy, userAgent)
+		if err != nil {
+			fatalf("Invalid CONTROL_PROXY: %v", err)
+		}
+	}
+	var urls []string
+	interval := 5 * time.Minute
+	if keepAliveURLs != "" {
+		for _, u := range strings.Split(keepAliveURLs, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		if keepAliveInterval != "" {
+			interval, err = time.ParseDuration(keepAliveInterval)
+			if err != nil || interval <= 0 {
+				fatalf("Invalid KEEPALIVE_INTERVAL: %v", keepAliveInterval)
+			}
+		}
+		logf("keep-alive: %d urls every %v", len(urls), interval)
+	}
+	if trafficFile == "-" {
+		trafficFile = ""
+	}
+	traffic = loadTraffic(trafficFile)
+	go traffic.run(time.Minute)
+
+	network, addr := "tcp", net.JoinHostPort(listenAddr, port)
+	if path, ok := strings.CutPrefix(listenAddr, "unix:"); ok {
+		network, addr = "unix", path
+		// Left behind by a previous run that did not shut down cleanly
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+	}
+	logf("listen: %s", addr)
+	server, err := net.Listen(network, addr)
+	if err != nil {
+		fatalf("Failed to listen: %v", err)
+	}
+	runHooks("post-listen", map[string]string{"addr": server.Addr().String()})
+	if keepAliveURLs != "" {
+		go runKeepAlive(urls, interval)
+	}
+
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	// These describe the deployment, so they stay behind ADMIN_TOKEN rather
+	// than help a prober fingerprint it.
+	mux.HandleFunc("/status", requireMonitor(handleStatus))
+	mux.HandleFunc("/metrics", requireMonitor(handleMetrics))
+	mux.HandleFunc("/api/summary", requireMonitor(newSummary().ServeHTTP))
+	mux.HandleFunc("/api/traffic", requireAdmin(traffic.ServeHTTP))
+	mux.HandleFunc("/api/blocked", requireMonitor(func(w http.ResponseWriter, r *http.Request) {
+		reloadMu.RLock()
+		b := blocked
+		reloadMu.RUnlock()
+		b.ServeHTTP(w, r)
+	}))
+	fallbacks, err := parseFallbacks(fallbackSpec)
+	if err != nil {
+		fatalf("Invalid FALLBACKS: %v", err)
+	}
+	for path, h := range fallbacks {
+		mux.Handle(path, h)
+		mux.Handle(path+"/", h)
+		logf("fallback: %s", path)
+	}
+	if filesDir != "" {
+		mux.Handle("/files/", fileServer(filesDir))
+	}
+	mux.HandleFunc("/admin/speedtest", requireAdmin(handleSpeedtest))
+	mux.HandleFunc("/admin/connlog", requireAdmin(connlog.ServeHTTP))
+	mux.HandleFunc("/admin/reload", requireAdmin(handleReload))
+	mux.HandleFunc("/admin/audit", requireAdmin(audit.ServeHTTP))
+	mux.HandleFunc("/admin/logs/", requireAdmin(handleLogs))
+	if wsPath == "auto" {
+		wsPath = derivePath(users[0])
+		logf("ws path: %s", wsPath)
+	}
+	if wsPath == "" {
+		wsPath = "/"
+	}
+	mux.HandleFunc(wsPath, func(w http.ResponseWriter, r *http.Request) {
+		handleConnection(w, r, upgrader)
+	})
+
+	srv := &http.Server{Handler: mux}
+	done := make(chan struct{})
+	go func() {
+		handleSignals(srv, grace)
+		close(done)
+	}()
+
+	err = srv.Serve(server)
+	if err != http.ErrServerClosed {
+		fatalf("Serve error: %v", err)
+	}
+	<-done
 }
 
-func handleConnection(conn net.Conn, upgrader websocket.Upgrader) {
-	defer conn.Close()
+func handleConnection(w http.ResponseWriter, r *http.Request, upgrader websocket.Upgrader) {
+	reloadMu.RLock()
+	us, bl, g := users, blocked, geo
+	reloadMu.RUnlock()
 
-	ws, _, err := upgrader.Upgrade(conn)
+	if !g.allowed(r) {
+		logf("Country rejected: %s", r.Header.Get("CF-IPCountry"))
+		rejections["country"].Add(1)
+		http.Error(w, tr("forbidden"), http.StatusForbidden)
+		return
+	}
+
+	relays.Add(1)
+	defer relays.Done()
+	activeRelays.Add(1)
+	defer activeRelays.Add(-1)
+
+	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Upgrade error: %v", err)
+		logf("Upgrade error: %v", err)
 		return
 	}
 	defer ws.Close()
 
 	_, msg, err := ws.ReadMessage()
 	if err != nil {
-		log.Printf("Read message error: %v", err)
+		logf("Read message error: %v", err)
 		return
 	}
 
 	// Validate UUID
 	version := msg[0]
-	id := msg[1:17]
-	for i := 0; i < len(id); i++ {
-		v, _ := parseHex(uuid[i*2 : i*2+2])
-		if id[i] != byte(v) {
-			return
-		}
+	u := findUser(us, msg[1:17])
+	if u == nil {
+		rejections["auth"].Add(1)
+		return
+	}
+	user := u.name
+
+	if !devices.check(user, clientIP(r)) {
+		rejections["device_limit"].Add(1)
+		return
+	}
+	if !conns.acquire(user) {
+		logf("Conn limit reached: %s", r.RemoteAddr)
+		rejections["conn_limit"].Add(1)
+		return
 	}
+	defer conns.release(user)
+	traffic.hit(user)
+	relaysTotal.Add(1)
 
 	// Parse message
 	i := int(msg[17]) + 19
@@ -97,19 +392,27 @@ func handleConnection(conn net.Conn, upgrader websocket.Upgrader) {
 		return
 	}
 
-	log.Printf("conn: %s %d", host, port)
+	if rule := bl.check(host, port); rule != "" {
+		logf("Blocked: %s %d (%s)", host, port, rule)
+		return
+	}
+
+	logf("conn: %s %d", host, port)
+	connlog.add(user, clientIP(r), host, port)
 
 	// Send response
 	err = ws.WriteMessage(websocket.BinaryMessage, []byte{version, 0})
 	if err != nil {
-		log.Printf("Write message error: %v", err)
+		logf("Write message error: %v", err)
 		return
 	}
 
 	// Connect to target
-	targetConn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
+	dialer := net.Dialer{KeepAlive: keepAlive}
+	targetConn, err := dialer.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
 	if err != nil {
-		log.Printf("Conn-Err: %v %s:%d", err, host, port)
+		logf("Conn-Err: %v %s:%d", err, host, port)
+		dialErrors.Add(1)
 		return
 	}
 	defer targetConn.Close()
@@ -119,41 +422,62 @@ func handleConnection(conn net.Conn, upgrader websocket.Upgrader) {
 	if len(remaining) > 0 {
 		_, err = targetConn.Write(remaining)
 		if err != nil {
-			log.Printf("Write to target error: %v", err)
+			logf("Write to target error: %v", err)
 			return
 		}
+		traffic.add(user, int64(len(remaining)), 0)
+	}
+
+	client := ws.UnderlyingConn()
+	if tc, ok := client.(*net.TCPConn); ok && keepAlive != 0 {
+		tc.SetKeepAlive(keepAlive > 0)
+		if keepAlive > 0 {
+			tc.SetKeepAlivePeriod(keepAlive)
+		}
+	}
+
+	// Push both read deadlines out whenever data moves
+	touch := func() {}
+	if idleTimeout > 0 {
+		touch = func() {
+			deadline := time.Now().Add(idleTimeout)
+			client.SetReadDeadline(deadline)
+			targetConn.SetReadDeadline(deadline)
+		}
+		touch()
 	}
 
 	// Pipe data between connections
 	go func() {
-		_, err := copyBuffer(targetConn, ws.UnderlyingConn())
+		_, err := copyBuffer(targetConn, client, func(n int64) {
+			traffic.add(user, n, 0)
+			touch()
+		})
 		if err != nil {
-			log.Printf("E1: %v", err)
+			logf("E1: %v", err)
 		}
 	}()
-	_, err = copyBuffer(ws.UnderlyingConn(), targetConn)
+	_, err = copyBuffer(client, targetConn, func(n int64) {
+		traffic.add(user, 0, n)
+		touch()
+	})
 	if err != nil {
-		log.Printf("E2: %v", err)
+		logf("E2: %v", err)
 	}
 }
 
-// Helper function to parse hex string to int
-func parseHex(hex string) (int, error) {
-	var result int
-	_, err := fmt.Sscanf(hex, "%x", &result)
-	return result, err
-}
-
-// Copy buffer between connections
-func copyBuffer(dst net.Conn, src net.Conn) (int64, error) {
+// Copy buffer between connections, reporting each chunk written to count
+func copyBuffer(dst net.Conn, src net.Conn, count func(int64)) (int64, error) {
 	buf := make([]byte, 32*1024)
 	var written int64
 	for {
 		nr, er := src.Read(buf)
 		if nr > 0 {
+			limiter.wait(nr)
 			nw, ew := dst.Write(buf[0:nr])
 			if nw > 0 {
 				written += int64(nw)
+				count(int64(nw))
 			}
 			if ew != nil {
 				return written, ew
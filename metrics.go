@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Counters only exported through /metrics.
+var (
+	relaysTotal       atomic.Int64
+	dialErrors        atomic.Int64
+	hookFailures      atomic.Int64
+	keepAliveFailures atomic.Int64
+
+	rejections = map[string]*atomic.Int64{
+		"country":      new(atomic.Int64),
+		"auth":         new(atomic.Int64),
+		"device_limit": new(atomic.Int64),
+		"conn_limit":   new(atomic.Int64),
+	}
+)
+
+// Prometheus text exposition of the relay's counters and gauges.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("relay_uptime_seconds", "gauge", "Seconds since the process started.")
+	fmt.Fprintf(w, "relay_uptime_seconds %d\n", int64(time.Since(started).Seconds()))
+
+	metric("relay_active", "gauge", "Relays currently open.")
+	fmt.Fprintf(w, "relay_active %d\n", activeRelays.Load())
+
+	metric("relay_total", "counter", "Relays accepted since start.")
+	fmt.Fprintf(w, "relay_total %d\n", relaysTotal.Load())
+
+	metric("relay_rejected_total", "counter", "Connections refused before relaying, by reason.")
+	reasons := make([]string, 0, len(rejections))
+	for reason := range rejections {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "relay_rejected_total{reason=%q} %d\n", reason, rejections[reason].Load())
+	}
+
+	metric("relay_dial_errors_total", "counter", "Failed connections to relay targets.")
+	fmt.Fprintf(w, "relay_dial_errors_total %d\n", dialErrors.Load())
+
+	reloadMu.RLock()
+	bl := blocked
+	reloadMu.RUnlock()
+	metric("relay_blocked_total", "counter", "Destinations refused by BLOCK_PORTS and BLOCK_DOMAINS, by rule.")
+	bl.mu.Lock()
+	rules := make([]string, 0, len(bl.hits))
+	for rule := range bl.hits {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	for _, rule := range rules {
+		fmt.Fprintf(w, "relay_blocked_total{rule=%q} %d\n", rule, bl.hits[rule])
+	}
+	bl.mu.Unlock()
+
+	traffic.mu.Lock()
+	up, down := traffic.Total.Up, traffic.Total.Down
+	traffic.mu.Unlock()
+	metric("relay_traffic_bytes_total", "counter", "Bytes relayed this month, reset on rollover.")
+	fmt.Fprintf(w, "relay_traffic_bytes_total{direction=\"up\"} %d\n", up)
+	fmt.Fprintf(w, "relay_traffic_bytes_total{direction=\"down\"} %d\n", down)
+
+	metric("relay_hook_failures_total", "counter", "Lifecycle hook commands or callbacks that failed.")
+	fmt.Fprintf(w, "relay_hook_failures_total %d\n", hookFailures.Load())
+
+	metric("relay_keepalive_failures_total", "counter", "Keep-alive requests that failed.")
+	fmt.Fprintf(w, "relay_keepalive_failures_total %d\n", keepAliveFailures.Load())
+}
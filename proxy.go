@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Networks allowed to tell us the client address through X-Forwarded-For.
+var trustedProxies []netip.Prefix
+
+// Parse comma separated addresses and CIDR ranges.
+func parseProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy %q", s)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q", s)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Address of the peer that opened the connection.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Whether the CDN headers on r can be believed: from anyone until
+// TRUSTED_PROXIES is set, then only from those peers.
+func trustHeaders(r *http.Request) bool {
+	return len(trustedProxies) == 0 || isTrustedProxy(peerIP(r))
+}
+
+// Client address, preferring the headers set by the CDN in front of us. The
+// leftmost X-Forwarded-For entry is whatever the client sent, so only the
+// hops appended by trusted proxies are used.
+func clientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !trustHeaders(r) {
+		return peer
+	}
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+		return ip
+	}
+	if len(trustedProxies) > 0 {
+		hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			if ip := strings.TrimSpace(hops[i]); ip != "" && !isTrustedProxy(ip) {
+				return ip
+			}
+		}
+	}
+	return peer
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Guards the settings /admin/reload can replace: users, blocked and geo.
+var reloadMu sync.RWMutex
+
+// The settings loadAccess builds users, blocked and geo from.
+type accessSettings struct {
+	uuid, uuidList                 string
+	blockPorts, blockDomains       string
+	allowCountries, blockCountries string
+}
+
+// Parse the client list and access filters and swap them in. Relays already
+// open keep the settings they started with.
+func loadAccess(s accessSettings) error {
+	list := s.uuidList
+	if list == "" {
+		list = s.uuid
+	}
+	if list == "" {
+		list = "b84a3458-e83a-4337-ada2-b303b6d2a841"
+	}
+	u, err := parseUsers(list)
+	if err != nil {
+		return fmt.Errorf("UUIDS: %w", err)
+	}
+	b, err := parseBlocklist(s.blockPorts, s.blockDomains)
+	if err != nil {
+		return fmt.Errorf("BLOCK_PORTS: %w", err)
+	}
+	g := &countryFilter{
+		allow: parseCountries(s.allowCountries),
+		deny:  parseCountries(s.blockCountries),
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if blocked != nil {
+		blocked.mu.Lock()
+		for rule, n := range blocked.hits {
+			b.hits[rule] = n
+		}
+		blocked.mu.Unlock()
+	}
+	users, blocked, geo = u, b, g
+	return nil
+}
+
+// Re-read CONFIG_FILE and the reloadable settings, so clients and filters can
+// change without a redeploy. Everything else still needs a restart.
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, tr("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := reloadConfig(); err != nil {
+		logf("Reload error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s := accessSettings{
+		uuid:           getenv("UUID"),
+		uuidList:       getenv("UUIDS"),
+		blockPorts:     getenv("BLOCK_PORTS"),
+		blockDomains:   getenv("BLOCK_DOMAINS"),
+		allowCountries: getenv("ALLOW_COUNTRIES"),
+		blockCountries: getenv("BLOCK_COUNTRIES"),
+	}
+	if err := loadAccess(s); err != nil {
+		logf("Reload error: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reloadMu.RLock()
+	n := len(users)
+	reloadMu.RUnlock()
+	logf("reloaded: %d users", n)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"users": n})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Open relays and running hooks, waited on during shutdown.
+var (
+	relays  sync.WaitGroup
+	hooksWG sync.WaitGroup
+)
+
+// Once set, runHooks starts nothing more, so hooksWG can be waited on while
+// hijacked relays that outlive the server are still running.
+var (
+	hooksMu     sync.Mutex
+	hooksClosed bool
+)
+
+// Closed when shutdown starts, to end long-lived responses such as log
+// streams that the server would otherwise wait on.
+var stopping = make(chan struct{})
+
+// Wait for SIGINT or SIGTERM, then stop accepting, give open relays and
+// hooks up to grace to finish and flush the traffic counters.
+func handleSignals(srv *http.Server, grace time.Duration) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	logf("shutdown: %v", <-sig)
+	signal.Stop(sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	close(stopping)
+	runHooks("pre-shutdown", nil)
+	if err := srv.Shutdown(ctx); err != nil {
+		logf("Shutdown error: %v", err)
+	}
+	if !waitContext(ctx, &relays) {
+		logf("Shutdown error: %v", "relays still open")
+	}
+	hooksMu.Lock()
+	hooksClosed = true
+	hooksMu.Unlock()
+	if !waitContext(ctx, &hooksWG) {
+		logf("Shutdown error: %v", "hooks still running")
+	}
+	traffic.save()
+}
+
+// Wait for wg, reporting false if ctx ends first.
+func waitContext(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
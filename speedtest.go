@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxSpeedtestMB = 100
+
+// Random so the CDN in front of the relay cannot compress it away.
+var speedtestChunk = func() []byte {
+	buf := make([]byte, 64*1024)
+	rand.Read(buf)
+	return buf
+}()
+
+// GET streams size MB (default 10) for the client to time the download, POST
+// drains the request body and reports the measured upload speed. Only upload
+// Mbps is measured here; download speed and latency are not reported and are
+// left to the client, e.g. by timing a GET and a GET with size=0.
+func handleSpeedtest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		size := 10
+		if s := r.URL.Query().Get("size"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || n > maxSpeedtestMB {
+				http.Error(w, tr("invalid size"), http.StatusBadRequest)
+				return
+			}
+			size = n
+		}
+
+		total := int64(size) * 1024 * 1024
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(total, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		for total > 0 {
+			chunk := speedtestChunk
+			if total < int64(len(chunk)) {
+				chunk = chunk[:total]
+			}
+			limiter.wait(len(chunk))
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			total -= int64(len(chunk))
+		}
+
+	case http.MethodPost:
+		start := time.Now()
+		body := http.MaxBytesReader(w, r.Body, maxSpeedtestMB*1024*1024)
+		buf := make([]byte, 32*1024)
+		var n int64
+		for {
+			nr, err := body.Read(buf)
+			if nr > 0 {
+				limiter.wait(nr)
+				n += int64(nr)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		elapsed := time.Since(start)
+
+		var mbps float64
+		if elapsed > 0 {
+			mbps = float64(n) * 8 / elapsed.Seconds() / 1000 / 1000
+		}
+		logf("speedtest: %d bytes in %v", n, elapsed)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"bytes":      n,
+			"elapsed_ms": elapsed.Milliseconds(),
+			"mbps":       mbps,
+		})
+
+	default:
+		http.Error(w, tr("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
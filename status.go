@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	started      = time.Now()
+	activeRelays atomic.Int64
+)
+
+// Snapshot of each subsystem for debugging a deployment without a shell.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	reloadMu.RLock()
+	us, bl := users, blocked
+	reloadMu.RUnlock()
+
+	status := map[string]any{
+		"uptime_seconds": int64(time.Since(started).Seconds()),
+		"active_relays":  activeRelays.Load(),
+		"users":          len(us),
+	}
+
+	traffic.mu.Lock()
+	t := map[string]any{
+		"month":     traffic.Month,
+		"total":     traffic.Total,
+		"file":      traffic.path,
+		"last_save": nil,
+	}
+	if !traffic.saved.IsZero() {
+		t["last_save"] = traffic.saved
+	}
+	traffic.mu.Unlock()
+	status["traffic"] = t
+
+	bl.mu.Lock()
+	var hits int64
+	for _, n := range bl.hits {
+		hits += n
+	}
+	bl.mu.Unlock()
+	status["blocked"] = hits
+
+	if connlog != nil {
+		connlog.mu.Lock()
+		status["conn_log_entries"] = len(connlog.entries)
+		connlog.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
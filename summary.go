@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// What the relay started with, served at /api/summary so the effective
+// settings can be checked without reading the startup log.
+type summary struct {
+	Started      time.Time `json:"started"`
+	Listen       string    `json:"listen,omitempty"`
+	Port         string    `json:"port"`
+	Protocol     string    `json:"protocol"`
+	Lang         string    `json:"lang"`
+	Users        int       `json:"users"`
+	RateLimit    string    `json:"rate_limit,omitempty"`
+	MaxConns     string    `json:"max_conns,omitempty"`
+	DeviceLimit  string    `json:"device_limit,omitempty"`
+	BlockPorts   string    `json:"block_ports,omitempty"`
+	BlockDomains string    `json:"block_domains,omitempty"`
+	Countries    struct {
+		Allow string `json:"allow,omitempty"`
+		Block string `json:"block,omitempty"`
+	} `json:"countries"`
+	TrafficFile string `json:"traffic_file,omitempty"`
+	ConnLog     bool   `json:"conn_log"`
+	Admin       bool   `json:"admin"`
+}
+
+func newSummary() *summary {
+	s := &summary{
+		Started:      time.Now().UTC(),
+		Listen:       listenAddr,
+		Port:         port,
+		Protocol:     "vless+ws",
+		Lang:         lang,
+		Users:        len(users),
+		RateLimit:    rateLimit,
+		MaxConns:     maxConns,
+		DeviceLimit:  deviceLimit,
+		BlockPorts:   blockPorts,
+		BlockDomains: blockDomains,
+		TrafficFile:  trafficFile,
+		ConnLog:      connlog != nil,
+		Admin:        adminToken != "",
+	}
+	s.Countries.Allow = allowCountries
+	s.Countries.Block = blockCountries
+	return s
+}
+
+func (s *summary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type trafficCounter struct {
+	Up       int64      `json:"up"`
+	Down     int64      `json:"down"`
+	Hits     int64      `json:"hits,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Per-user and total byte counters for the current month, persisted to a
+// JSON file so they survive restarts.
+type trafficStats struct {
+	mu    sync.Mutex
+	path  string
+	dirty bool
+	saved time.Time
+	// Last write error logged, so a path that cannot be written is only
+	// reported once rather than on every flush
+	failed string
+
+	Month string                     `json:"month"`
+	Total trafficCounter             `json:"total"`
+	Users map[string]*trafficCounter `json:"users"`
+}
+
+// Location the monthly reset follows, from SCHEDULE_TIMEZONE.
+var scheduleLoc = time.Local
+
+func currentMonth() string {
+	return time.Now().In(scheduleLoc).Format("2006-01")
+}
+
+func loadTraffic(path string) *trafficStats {
+	t := &trafficStats{
+		path:  path,
+		Month: currentMonth(),
+		Users: make(map[string]*trafficCounter),
+	}
+	if path == "" {
+		return t
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logf("Read traffic error: %v", err)
+		}
+		return t
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		logf("Parse traffic error: %v", err)
+	}
+	if t.Users == nil {
+		t.Users = make(map[string]*trafficCounter)
+	}
+	t.rollover()
+	return t
+}
+
+// Reset the counters when a new month has started. Caller holds mu or owns t.
+func (t *trafficStats) rollover() {
+	month := currentMonth()
+	if t.Month == month {
+		return
+	}
+	logf("traffic reset: %s -> %s", t.Month, month)
+	runHooks("traffic-reset", map[string]string{
+		"month":      t.Month,
+		"total_up":   strconv.FormatInt(t.Total.Up, 10),
+		"total_down": strconv.FormatInt(t.Total.Down, 10),
+	})
+	t.Month = month
+	t.Total = trafficCounter{}
+	t.Users = make(map[string]*trafficCounter)
+	t.dirty = true
+}
+
+// Counter for user, created on first use. Caller holds mu.
+func (t *trafficStats) user(name string) *trafficCounter {
+	t.rollover()
+	c := t.Users[name]
+	if c == nil {
+		c = &trafficCounter{}
+		t.Users[name] = c
+	}
+	return c
+}
+
+// Count a relay opened by user.
+func (t *trafficStats) hit(user string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.user(user)
+	now := time.Now().UTC()
+	c.Hits++
+	c.LastSeen = &now
+	t.dirty = true
+}
+
+func (t *trafficStats) add(user string, up, down int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := t.user(user)
+	c.Up += up
+	c.Down += down
+	t.Total.Up += up
+	t.Total.Down += down
+	t.dirty = true
+}
+
+func (t *trafficStats) save() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollover()
+	if t.path == "" {
+		return
+	}
+	if !t.dirty {
+		// Some hosts wipe local storage while the app runs, so put the
+		// file back from memory rather than lose it until the next change.
+		if _, err := os.Stat(t.path); !os.IsNotExist(err) {
+			return
+		}
+		if !t.saved.IsZero() {
+			logf("Traffic file missing, rewriting: %s", t.path)
+		}
+	}
+	// The directory may have been wiped along with the file.
+	os.MkdirAll(filepath.Dir(t.path), 0o700)
+	data, err := json.Marshal(t)
+	if err != nil {
+		logf("Encode traffic error: %v", err)
+		return
+	}
+	tmp := t.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err == nil {
+		err = os.Rename(tmp, t.path)
+	}
+	if err != nil {
+		if err.Error() != t.failed {
+			logf("Write traffic error: %v", err)
+			t.failed = err.Error()
+		}
+		return
+	}
+	t.failed = ""
+	t.dirty = false
+	t.saved = time.Now().UTC()
+}
+
+// Flush the counters every interval, which also applies the monthly reset
+// while the relay is idle.
+func (t *trafficStats) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		t.save()
+	}
+}
+
+func (t *trafficStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	t.rollover()
+	data, err := json.Marshal(t)
+	t.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
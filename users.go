@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// A client allowed to use the relay. The name keys its limits, traffic and
+// log entries so the full UUID is never exposed. An unnamed user's name is a
+// UUID prefix, so anything listing names stays behind ADMIN_TOKEN.
+type user struct {
+	name string
+	id   []byte
+}
+
+// Parse comma separated [alias:]uuid entries. Without an alias a user is
+// named after the first 8 hex digits of its UUID.
+func parseUsers(list string) ([]user, error) {
+	var users []user
+	names := make(map[string]bool)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(entry, ":")
+		if !ok {
+			name, raw = "", entry
+		}
+		raw = strings.ReplaceAll(raw, "-", "")
+		id, err := hex.DecodeString(raw)
+		if err != nil || len(id) != 16 {
+			return nil, fmt.Errorf("invalid uuid %q", entry)
+		}
+		if name == "" {
+			name = raw[:8]
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate user %q", name)
+		}
+		names[name] = true
+		users = append(users, user{name: name, id: id})
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no uuid in %q", list)
+	}
+	return users, nil
+}
+
+// Find the user with the given 16 byte id, or nil.
+func findUser(users []user, id []byte) *user {
+	var found *user
+	for i := range users {
+		if subtle.ConstantTimeCompare(users[i].id, id) == 1 {
+			found = &users[i]
+		}
+	}
+	return found
+}
+
+// A WebSocket path derived from the user's UUID, so deployments sharing a
+// config template do not all answer on the same well-known path.
+func derivePath(u user) string {
+	sum := sha256.Sum256(append([]byte("ws-path:"), u.id...))
+	return "/" + hex.EncodeToString(sum[:6])
+}
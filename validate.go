@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A problem with the settings. Errors stop startup, warnings explain what
+// will be ignored or is risky.
+type finding struct {
+	fatal   bool
+	setting string
+	format  string
+	args    []any
+}
+
+// Routes served by the relay itself, which FALLBACKS may not shadow.
+var builtinRoutes = []string{"/status", "/metrics", "/api", "/admin", "/files"}
+
+// Check the settings as a whole, beyond what each parser rejects, so a
+// misconfiguration shows up at startup instead of as a silent no-op.
+func validateConfig() []finding {
+	var fs []finding
+	warn := func(setting, format string, args ...any) {
+		fs = append(fs, finding{setting: setting, format: format, args: args})
+	}
+	fail := func(setting, format string, args ...any) {
+		fs = append(fs, finding{fatal: true, setting: setting, format: format, args: args})
+	}
+
+	if !strings.HasPrefix(listenAddr, "unix:") {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			fail("PORT", "%q is not a port between 1 and 65535", port)
+		}
+	}
+
+	for _, name := range unknownSettings() {
+		warn("CONFIG_FILE", "unknown setting %s", name)
+	}
+
+	switch {
+	case uuid == "" && uuidList == "":
+		warn("UUID", "not set, the built-in default UUID is public")
+	case uuid != "" && uuidList != "":
+		warn("UUID", "ignored because UUIDS is set")
+	}
+	list := uuidList
+	if list == "" {
+		list = uuid
+	}
+	if _, err := parseUsers(list); list != "" && err != nil {
+		fail("UUIDS", "%v", err)
+	}
+
+	if deviceLimit == "" {
+		if deviceWindow != "" || deviceLimitMode != "" {
+			warn("DEVICE_LIMIT", "not set, DEVICE_WINDOW and DEVICE_LIMIT_MODE are ignored")
+		}
+	} else if deviceLimitMode != "" && deviceLimitMode != "alert" && deviceLimitMode != "block" {
+		warn("DEVICE_LIMIT_MODE", "%q is not alert or block, blocking", deviceLimitMode)
+	}
+
+	if (allowCountries != "" || blockCountries != "") && trustedProxySpec == "" {
+		warn("ALLOW_COUNTRIES", "CF-IPCountry is believed from any client, set TRUSTED_PROXIES to the CDN")
+	}
+
+	switch connLogEnable {
+	case "true":
+		if adminToken == "" {
+			warn("CONN_LOG", "enabled without ADMIN_TOKEN, the log cannot be exported")
+		}
+	case "", "false":
+		if connLogRetention != "" || connLogMax != "" || connLogSalt != "" {
+			warn("CONN_LOG", "not enabled, CONN_LOG_RETENTION, CONN_LOG_MAX and CONN_LOG_SALT are ignored")
+		}
+	default:
+		warn("CONN_LOG", "%q is not true or false, disabled", connLogEnable)
+	}
+
+	if adminToken == "" {
+		warn("ADMIN_TOKEN", "not set, /admin, /api, /status and /metrics are disabled")
+	} else if len(adminToken) < 16 {
+		warn("ADMIN_TOKEN", "shorter than 16 characters")
+	}
+
+	if keepAliveURLs == "" && keepAliveInterval != "" {
+		warn("KEEPALIVE_URLS", "not set, KEEPALIVE_INTERVAL is ignored")
+	}
+	for _, u := range strings.Split(keepAliveURLs, ",") {
+		if u = strings.TrimSpace(u); u != "" && !isHTTPURL(u) {
+			fail("KEEPALIVE_URLS", "%q is not an http(s) URL", u)
+		}
+	}
+	if hookCmd != "" && strings.TrimSpace(hookCmd) == "" {
+		fail("HOOK_CMD", "%q is blank", hookCmd)
+	}
+	if hookURL != "" && !isHTTPURL(hookURL) {
+		fail("HOOK_URL", "%q is not an http(s) URL", hookURL)
+	}
+
+	fallbacks, _ := parseFallbacks(fallbackSpec)
+	for path := range fallbacks {
+		for _, route := range builtinRoutes {
+			if path == route || strings.HasPrefix(path, route+"/") {
+				fail("FALLBACKS", "%s conflicts with the built-in %s route", path, route)
+			}
+		}
+	}
+	if wsPath != "" && wsPath != "auto" {
+		if !strings.HasPrefix(wsPath, "/") {
+			fail("WS_PATH", "%q must start with / or be auto", wsPath)
+		}
+		for _, route := range builtinRoutes {
+			if wsPath == route || strings.HasPrefix(wsPath, route+"/") {
+				fail("WS_PATH", "%s conflicts with the built-in %s route", wsPath, route)
+			}
+		}
+		// Each fallback also serves everything below its path. A bare "/"
+		// only catches what nothing else does, so it never collides.
+		ws := strings.TrimSuffix(wsPath, "/")
+		for path := range fallbacks {
+			if ws == "" {
+				break
+			}
+			if ws == path || strings.HasPrefix(ws, path+"/") || strings.HasPrefix(path, ws+"/") {
+				fail("WS_PATH", "%s conflicts with the FALLBACKS route %s", wsPath, path)
+			}
+		}
+	}
+	if filesDir != "" {
+		if fi, err := os.Stat(filesDir); err != nil || !fi.IsDir() {
+			fail("FILES_DIR", "%q is not a directory", filesDir)
+		}
+	}
+
+	return fs
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Log every finding and stop if any of them is an error.
+func reportConfig(fs []finding) {
+	fatal := 0
+	for _, f := range fs {
+		level := "warning"
+		if f.fatal {
+			level = "error"
+			fatal++
+		}
+		logf("config %s: %s: %s", tr(level), f.setting, sprintf(f.format, f.args...))
+	}
+	if fatal > 0 {
+		fatalf("Invalid configuration: %d errors", fatal)
+	}
+}